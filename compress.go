@@ -0,0 +1,333 @@
+package httpzaplog
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/go-chi/chi/v5/middleware"
+	"go.uber.org/zap"
+	"golang.org/x/exp/slices"
+)
+
+// CompressOptions configures the compression middleware chained in via
+// Options.Compress.
+type CompressOptions struct {
+	// Level is passed to the negotiated encoder (gzip/deflate: 1-9, brotli:
+	// 0-11). Out-of-range values fall back to that encoder's default.
+	Level int
+
+	// Types restricts compression to these content types, matched against
+	// the response's Content-Type with any "; charset=..." suffix stripped.
+	// Empty means compress every content type.
+	Types []string
+
+	// MinLength is the smallest response size, in bytes, worth compressing.
+	// Responses that end up smaller are written through uncompressed.
+	MinLength int
+}
+
+// Compress returns an http middleware that negotiates gzip, deflate, or
+// brotli from the request's Accept-Encoding header and transparently
+// compresses response bodies that qualify under level/types. Responses
+// smaller than 256 bytes are left uncompressed; use Options.Compress for
+// control over the threshold.
+func Compress(level int, types ...string) func(http.Handler) http.Handler {
+	opts := &CompressOptions{Level: level, Types: types, MinLength: 256}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			enc := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+			if enc == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			cw := newCompressWriter(w, enc, opts)
+			defer cw.Close()
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// negotiateEncoding picks the first of br, gzip, or deflate (in that
+// preference order) the client's Accept-Encoding header actually permits -
+// honoring explicit q=0 rejections and wildcard ("*") directives, rather than
+// a raw substring match that would e.g. treat "gzip;q=0" as accepting gzip.
+func negotiateEncoding(acceptEncoding string) string {
+	weights := parseAcceptEncoding(acceptEncoding)
+	for _, enc := range []string{"br", "gzip", "deflate"} {
+		if acceptEncodingAllows(weights, enc) {
+			return enc
+		}
+	}
+	return ""
+}
+
+type encodingWeight struct {
+	name string
+	q    float64
+}
+
+func parseAcceptEncoding(header string) []encodingWeight {
+	var weights []encodingWeight
+	for _, part := range strings.Split(header, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name := part
+		q := 1.0
+		if idx := strings.IndexByte(part, ';'); idx != -1 {
+			name = strings.TrimSpace(part[:idx])
+			if parsed, ok := parseQValue(part[idx+1:]); ok {
+				q = parsed
+			}
+		}
+		weights = append(weights, encodingWeight{name: strings.ToLower(name), q: q})
+	}
+	return weights
+}
+
+func parseQValue(params string) (float64, bool) {
+	for _, p := range strings.Split(params, ";") {
+		p = strings.TrimSpace(p)
+		if !strings.HasPrefix(p, "q=") {
+			continue
+		}
+		q, err := strconv.ParseFloat(strings.TrimPrefix(p, "q="), 64)
+		if err != nil {
+			return 0, false
+		}
+		return q, true
+	}
+	return 0, false
+}
+
+// acceptEncodingAllows reports whether enc may be used given the parsed
+// Accept-Encoding tokens: an explicit entry for enc wins (respecting its q
+// value), otherwise a wildcard ("*") entry applies, otherwise enc is not
+// acceptable.
+func acceptEncodingAllows(weights []encodingWeight, enc string) bool {
+	var wildcardQ *float64
+	for _, w := range weights {
+		switch w.name {
+		case enc:
+			return w.q > 0
+		case "*":
+			q := w.q
+			wildcardQ = &q
+		}
+	}
+	return wildcardQ != nil && *wildcardQ > 0
+}
+
+// compressWriter wraps an http.ResponseWriter - typically a
+// middleware.WrapResponseWriter, so its BytesWritten() ends up reporting the
+// on-wire (compressed) size - and transparently compresses the body once
+// it's clear the response qualifies: an eligible Content-Type and at least
+// opts.MinLength bytes written. bytesIn tracks the uncompressed byte count
+// handlers wrote, for logging compression ratio.
+type compressWriter struct {
+	http.ResponseWriter
+	enc      string
+	opts     *CompressOptions
+	bytesIn  int
+	status   int
+	buf      []byte
+	decided  bool
+	compress bool
+	encoder  io.WriteCloser
+	tee      io.Writer
+}
+
+func newCompressWriter(w http.ResponseWriter, enc string, opts *CompressOptions) *compressWriter {
+	return &compressWriter{ResponseWriter: w, enc: enc, opts: opts, status: http.StatusOK}
+}
+
+// Tee mirrors middleware.WrapResponseWriter's Tee: every byte the handler
+// writes is also copied to dst, in its original, pre-compression form - the
+// plain ww.Tee would instead capture whatever compressWriter sends to the
+// encoder, i.e. the compressed bytes.
+func (cw *compressWriter) Tee(dst io.Writer) {
+	cw.tee = dst
+}
+
+// BytesIn reports the number of uncompressed bytes the handler wrote.
+func (cw *compressWriter) BytesIn() int { return cw.bytesIn }
+
+// Encoding reports the negotiated Content-Encoding if the response ended up
+// compressed, or "" if it was written through uncompressed.
+func (cw *compressWriter) Encoding() string {
+	if cw.decided && cw.compress {
+		return cw.enc
+	}
+	return ""
+}
+
+// WriteHeader records the status but does not forward it yet - the
+// compression decision (and therefore the final Content-Encoding/
+// Content-Length headers) isn't made until enough of the body is seen.
+func (cw *compressWriter) WriteHeader(status int) {
+	cw.status = status
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if cw.tee != nil {
+		_, _ = cw.tee.Write(p)
+	}
+	cw.bytesIn += len(p)
+
+	if !cw.decided {
+		cw.buf = append(cw.buf, p...)
+		if cw.eligibleType() && len(cw.buf) < cw.opts.MinLength {
+			return len(p), nil
+		}
+		cw.decide(cw.eligibleType())
+		if err := cw.flushBuffered(); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+
+	if !cw.compress {
+		return cw.ResponseWriter.Write(p)
+	}
+	return cw.encoder.Write(p)
+}
+
+func (cw *compressWriter) eligibleType() bool {
+	if len(cw.opts.Types) == 0 {
+		return true
+	}
+	ct := cw.Header().Get("Content-Type")
+	if idx := strings.IndexByte(ct, ';'); idx != -1 {
+		ct = ct[:idx]
+	}
+	return slices.Contains(cw.opts.Types, strings.TrimSpace(ct))
+}
+
+func (cw *compressWriter) decide(compress bool) {
+	cw.decided = true
+	cw.compress = compress
+	if compress {
+		cw.Header().Set("Content-Encoding", cw.enc)
+		cw.Header().Add("Vary", "Accept-Encoding")
+	}
+	cw.Header().Del("Content-Length")
+	cw.ResponseWriter.WriteHeader(cw.status)
+	if compress {
+		cw.encoder = newEncoder(cw.enc, cw.ResponseWriter, cw.opts.Level)
+	}
+}
+
+func (cw *compressWriter) flushBuffered() error {
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	if cw.compress {
+		_, err := cw.encoder.Write(buf)
+		return err
+	}
+	_, err := cw.ResponseWriter.Write(buf)
+	return err
+}
+
+// Close finalizes the compression decision for responses that never reached
+// MinLength (or never wrote a body at all) and closes the encoder. It is
+// safe - and required - to call even if the handler never wrote anything.
+func (cw *compressWriter) Close() error {
+	if !cw.decided {
+		cw.decide(cw.eligibleType() && len(cw.buf) >= cw.opts.MinLength)
+		if err := cw.flushBuffered(); err != nil {
+			return err
+		}
+	}
+	if cw.compress {
+		return cw.encoder.Close()
+	}
+	return nil
+}
+
+func newEncoder(enc string, w io.Writer, level int) io.WriteCloser {
+	switch enc {
+	case "gzip":
+		if level < gzip.HuffmanOnly || level > gzip.BestCompression {
+			level = gzip.DefaultCompression
+		}
+		gw, _ := gzip.NewWriterLevel(w, level)
+		return gw
+	case "deflate":
+		if level < flate.HuffmanOnly || level > flate.BestCompression {
+			level = flate.DefaultCompression
+		}
+		fw, _ := flate.NewWriter(w, level)
+		return fw
+	default: // "br"
+		if level < 0 || level > 11 {
+			level = brotli.DefaultCompression
+		}
+		return brotli.NewWriterLevel(w, level)
+	}
+}
+
+// Flush implements http.Flusher, flushing both the encoder (if any) and the
+// underlying writer, so streaming responses still stream.
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		cw.decide(cw.eligibleType() && len(cw.buf) >= cw.opts.MinLength)
+		_ = cw.flushBuffered()
+	}
+	if cw.compress {
+		if f, ok := cw.encoder.(interface{ Flush() error }); ok {
+			_ = f.Flush()
+		}
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker so WebSocket upgrades pass through
+// untouched - Write is never called again once the connection is hijacked.
+func (cw *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := cw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("httpzaplog: underlying ResponseWriter does not support Hijack")
+	}
+	return hj.Hijack()
+}
+
+// Push implements http.Pusher, delegating to the underlying writer so
+// HTTP/2 server push keeps working.
+func (cw *compressWriter) Push(target string, opts *http.PushOptions) error {
+	if p, ok := cw.ResponseWriter.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
+// applyCompressionFields attaches bytesIn (uncompressed), bytesOut (on-wire,
+// via ww), the chosen Content-Encoding, and the resulting compression ratio
+// to entry's logger.
+func applyCompressionFields(entry *RequestLoggerEntry, cw *compressWriter, ww middleware.WrapResponseWriter) {
+	bytesIn, bytesOut := cw.BytesIn(), ww.BytesWritten()
+	fields := []zap.Field{
+		zap.Int("bytesIn", bytesIn),
+		zap.Int("bytesOut", bytesOut),
+	}
+	if enc := cw.Encoding(); enc != "" {
+		fields = append(fields, zap.String("contentEncoding", enc))
+		if bytesOut > 0 {
+			fields = append(fields, zap.Float64("compressionRatio", float64(bytesIn)/float64(bytesOut)))
+		}
+	}
+	entry.Logger = entry.Logger.With(fields...)
+}
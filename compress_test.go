@@ -0,0 +1,97 @@
+package httpzaplog
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   string
+	}{
+		{"empty header", "", ""},
+		{"plain gzip", "gzip", "gzip"},
+		{"prefers br over gzip", "gzip, br", "br"},
+		{"br rejected with q=0 falls back to gzip", "br;q=0, gzip", "gzip"},
+		{"gzip rejected with q=0 falls back to deflate", "gzip;q=0, deflate", "deflate"},
+		{"all rejected with q=0", "gzip;q=0, br;q=0, deflate;q=0", ""},
+		{"wildcard allows any", "*", "br"},
+		{"wildcard rejected, explicit gzip still allowed", "*;q=0, gzip", "gzip"},
+		{"unsupported encoding only", "identity", ""},
+		{"whitespace and case insensitivity", " GZIP ,  br;q=0 ", "gzip"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := negotiateEncoding(tt.header); got != tt.want {
+				t.Errorf("negotiateEncoding(%q) = %q, want %q", tt.header, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompressWriterDecision(t *testing.T) {
+	t.Run("below MinLength is written through uncompressed", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		cw := newCompressWriter(rec, "gzip", &CompressOptions{MinLength: 256})
+		_, _ = cw.Write([]byte("short"))
+		_ = cw.Close()
+
+		if cw.Encoding() != "" {
+			t.Fatalf("Encoding() = %q, want empty (should not compress below MinLength)", cw.Encoding())
+		}
+		if rec.Body.String() != "short" {
+			t.Fatalf("body = %q, want %q", rec.Body.String(), "short")
+		}
+	})
+
+	t.Run("at or above MinLength is compressed", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		cw := newCompressWriter(rec, "gzip", &CompressOptions{MinLength: 4})
+		_, _ = cw.Write([]byte("this is long enough to compress"))
+		_ = cw.Close()
+
+		if cw.Encoding() != "gzip" {
+			t.Fatalf("Encoding() = %q, want gzip", cw.Encoding())
+		}
+		if rec.Header().Get("Content-Encoding") != "gzip" {
+			t.Fatalf("Content-Encoding header = %q, want gzip", rec.Header().Get("Content-Encoding"))
+		}
+	})
+
+	t.Run("ineligible content type is never compressed regardless of size", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		cw := newCompressWriter(rec, "gzip", &CompressOptions{MinLength: 4, Types: []string{"application/json"}})
+		cw.Header().Set("Content-Type", "image/png")
+		_, _ = cw.Write(bytes.Repeat([]byte("x"), 1024))
+		_ = cw.Close()
+
+		if cw.Encoding() != "" {
+			t.Fatalf("Encoding() = %q, want empty for ineligible content type", cw.Encoding())
+		}
+	})
+
+	t.Run("Tee captures pre-compression bytes", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		cw := newCompressWriter(rec, "gzip", &CompressOptions{MinLength: 4})
+		var tee bytes.Buffer
+		cw.Tee(&tee)
+
+		const body = "this response body should be visible in the tee, uncompressed"
+		_, _ = cw.Write([]byte(body))
+		_ = cw.Close()
+
+		if cw.Encoding() != "gzip" {
+			t.Fatalf("Encoding() = %q, want gzip", cw.Encoding())
+		}
+		if tee.String() != body {
+			t.Fatalf("tee captured %q, want the uncompressed body %q", tee.String(), body)
+		}
+		if rec.Body.String() == body {
+			t.Fatalf("response body was not compressed")
+		}
+	})
+}
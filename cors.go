@@ -0,0 +1,74 @@
+package httpzaplog
+
+import (
+	"context"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"github.com/illumitacit/httpzaplog/cors"
+)
+
+// CORSOptions wraps cors.Options with the logging integration Options.CORS
+// needs: origin/corsAllowed fields on every entry, a Warn on rejected
+// origins, and (optionally) quieter logging for preflight requests.
+type CORSOptions struct {
+	cors.Options
+
+	// SkipPreflight suppresses the verbose Request/Response log lines for
+	// preflight requests that CORS short-circuits. The origin/corsAllowed
+	// fields and the rejection Warn are still emitted regardless.
+	SkipPreflight bool
+}
+
+type corsSkipVerboseKey struct{}
+
+func withCORSSkipVerbose(ctx context.Context) context.Context {
+	return context.WithValue(ctx, corsSkipVerboseKey{}, true)
+}
+
+func corsSkipVerbose(ctx context.Context) bool {
+	skip, _ := ctx.Value(corsSkipVerboseKey{}).(bool)
+	return skip
+}
+
+type corsResultKey struct{}
+
+func withCORSResult(ctx context.Context, result cors.Result) context.Context {
+	return context.WithValue(ctx, corsResultKey{}, result)
+}
+
+// corsResultFromContext returns the cors.Result Handler attached to ctx
+// before building the log entry, so NewLogEntry can attach origin/
+// corsAllowed to both the request and response log lines consistently.
+func corsResultFromContext(ctx context.Context) (cors.Result, bool) {
+	result, ok := ctx.Value(corsResultKey{}).(cors.Result)
+	return result, ok
+}
+
+// applyCORS finishes handling a request already evaluated against opts (see
+// withCORSResult): it Warns on a rejected origin and, for preflight
+// requests, writes the response itself. It reports whether the caller
+// should stop processing the request (true for any preflight request,
+// handled or not). The origin/corsAllowed fields themselves are attached by
+// NewLogEntry, since they need to be on the log entry before that - not
+// after - for the request log line to carry them too.
+func applyCORS(opts *CORSOptions, result cors.Result, entry *RequestLoggerEntry, w http.ResponseWriter) (handled bool) {
+	if result.Origin != "" && !result.Allowed {
+		entry.Logger.Warn("CORS origin rejected", zap.String("origin", result.Origin))
+	}
+
+	if !result.Preflight {
+		return false
+	}
+
+	status := http.StatusNoContent
+	if !result.Allowed {
+		status = http.StatusForbidden
+	}
+	if !opts.SkipPreflight {
+		entry.Write(status, 0, w.Header(), 0, nil)
+	}
+	w.WriteHeader(status)
+	return true
+}
@@ -0,0 +1,131 @@
+// Package cors implements a small, dependency-free CORS middleware that can
+// be used standalone or chained into httpzaplog.RequestLogger via
+// Options.CORS.
+package cors
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Options configures the CORS middleware.
+type Options struct {
+	// AllowedOrigins is the list of origins a cross-origin request may come
+	// from. An entry of "*" allows any origin, and a leading "*." allows any
+	// subdomain of the remainder. Ignored if AllowOriginFunc is set.
+	AllowedOrigins []string
+
+	// AllowOriginFunc, if set, is called with the request's Origin header and
+	// overrides AllowedOrigins entirely.
+	AllowOriginFunc func(origin string) bool
+
+	// AllowedMethods is returned via Access-Control-Allow-Methods on
+	// preflight requests.
+	AllowedMethods []string
+
+	// AllowedHeaders is returned via Access-Control-Allow-Headers on
+	// preflight requests.
+	AllowedHeaders []string
+
+	// AllowCredentials sets Access-Control-Allow-Credentials: true.
+	AllowCredentials bool
+
+	// MaxAge sets how long a preflight response may be cached, via
+	// Access-Control-Max-Age. Zero disables the header.
+	MaxAge time.Duration
+}
+
+// Result is the outcome of evaluating a request against Options.
+type Result struct {
+	// Origin is the request's Origin header, or "" if it had none.
+	Origin string
+
+	// Allowed reports whether Origin was permitted. Always false when
+	// Origin is "".
+	Allowed bool
+
+	// Preflight reports whether the request was a CORS preflight request.
+	Preflight bool
+}
+
+// IsPreflight reports whether r is a CORS preflight request.
+func IsPreflight(r *http.Request) bool {
+	return r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+}
+
+// Handle evaluates r against opts and writes the appropriate CORS response
+// headers to w. It does not write a status code or body - callers are
+// responsible for responding (with 204 on an allowed preflight, 403 on a
+// rejected one, and otherwise continuing the middleware chain).
+func (opts Options) Handle(w http.ResponseWriter, r *http.Request) Result {
+	origin := r.Header.Get("Origin")
+	result := Result{Origin: origin, Preflight: IsPreflight(r)}
+	if origin == "" {
+		return result
+	}
+
+	result.Allowed = opts.isOriginAllowed(origin)
+	if !result.Allowed {
+		return result
+	}
+
+	header := w.Header()
+	header.Set("Access-Control-Allow-Origin", origin)
+	header.Add("Vary", "Origin")
+	if opts.AllowCredentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+
+	if result.Preflight {
+		if len(opts.AllowedMethods) > 0 {
+			header.Set("Access-Control-Allow-Methods", strings.Join(opts.AllowedMethods, ", "))
+		}
+		if len(opts.AllowedHeaders) > 0 {
+			header.Set("Access-Control-Allow-Headers", strings.Join(opts.AllowedHeaders, ", "))
+		}
+		if opts.MaxAge > 0 {
+			header.Set("Access-Control-Max-Age", strconv.Itoa(int(opts.MaxAge.Seconds())))
+		}
+	}
+
+	return result
+}
+
+func (opts Options) isOriginAllowed(origin string) bool {
+	if opts.AllowOriginFunc != nil {
+		return opts.AllowOriginFunc(origin)
+	}
+	for _, allowed := range opts.AllowedOrigins {
+		switch {
+		case allowed == "*":
+			return true
+		case allowed == origin:
+			return true
+		case strings.HasPrefix(allowed, "*.") && strings.HasSuffix(origin, allowed[1:]):
+			return true
+		}
+	}
+	return false
+}
+
+// CORS returns an http middleware that applies opts to every request,
+// responding to preflight OPTIONS requests directly (204 if allowed, 403 if
+// the origin was rejected) instead of calling next.
+func CORS(opts Options) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			result := opts.Handle(w, r)
+			if result.Preflight {
+				if !result.Allowed {
+					w.WriteHeader(http.StatusForbidden)
+					return
+				}
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
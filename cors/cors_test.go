@@ -0,0 +1,72 @@
+package cors
+
+import "testing"
+
+func TestIsOriginAllowed(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    Options
+		origin  string
+		allowed bool
+	}{
+		{
+			name:    "exact match",
+			opts:    Options{AllowedOrigins: []string{"https://example.com"}},
+			origin:  "https://example.com",
+			allowed: true,
+		},
+		{
+			name:    "no match",
+			opts:    Options{AllowedOrigins: []string{"https://example.com"}},
+			origin:  "https://evil.com",
+			allowed: false,
+		},
+		{
+			name:    "wildcard allows anything",
+			opts:    Options{AllowedOrigins: []string{"*"}},
+			origin:  "https://anything.example",
+			allowed: true,
+		},
+		{
+			name:    "subdomain wildcard matches subdomain",
+			opts:    Options{AllowedOrigins: []string{"*.example.com"}},
+			origin:  "https://api.example.com",
+			allowed: true,
+		},
+		{
+			name:    "subdomain wildcard does not match bare domain",
+			opts:    Options{AllowedOrigins: []string{"*.example.com"}},
+			origin:  "https://example.com",
+			allowed: false,
+		},
+		{
+			name:    "subdomain wildcard does not match unrelated suffix",
+			opts:    Options{AllowedOrigins: []string{"*.example.com"}},
+			origin:  "https://notexample.com",
+			allowed: false,
+		},
+		{
+			name: "AllowOriginFunc overrides AllowedOrigins",
+			opts: Options{
+				AllowedOrigins:  []string{"https://example.com"},
+				AllowOriginFunc: func(origin string) bool { return origin == "https://other.com" },
+			},
+			origin:  "https://other.com",
+			allowed: true,
+		},
+		{
+			name:    "empty AllowedOrigins allows nothing",
+			opts:    Options{},
+			origin:  "https://example.com",
+			allowed: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.opts.isOriginAllowed(tt.origin); got != tt.allowed {
+				t.Errorf("isOriginAllowed(%q) = %v, want %v", tt.origin, got, tt.allowed)
+			}
+		})
+	}
+}
@@ -0,0 +1,391 @@
+package httpzaplog
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"golang.org/x/exp/slices"
+)
+
+// Format selects one of the built-in access-log presets used by Handler when
+// Options.Formatter is nil. The zero value, FormatDefault, preserves
+// httpzaplog's existing httpRequest/httpResponse field shape.
+type Format int
+
+const (
+	// FormatDefault logs the request and response as nested httpRequest /
+	// httpResponse objects, as httpzaplog has always done.
+	FormatDefault Format = iota
+
+	// FormatCommon emits a single NCSA Common Log Format line per request.
+	FormatCommon
+
+	// FormatCombined emits an NCSA Combined Log Format line, i.e. Common Log
+	// Format with referer and user-agent appended.
+	FormatCombined
+
+	// FormatJSON emits a CloudEvents v1.0 envelope (specversion/type/source/
+	// id/time/datacontenttype/data) per https://github.com/cloudevents/spec,
+	// for pipelines that consume structured events rather than httpzaplog's
+	// own field shape.
+	FormatJSON
+)
+
+// Formatter controls exactly which zap fields (and how many log lines) are
+// emitted for a request.
+//
+// ContextFields returns the small set of fields that are always attached to
+// the request-scoped logger returned by LogEntry, independent of whether the
+// built-in request/response lines end up logged anywhere - keep it cheap, it
+// runs on every request regardless of level.
+//
+// FormatRequest and FormatResponse build the message and fields for the
+// built-in request/response lines. Handler only calls these after confirming
+// via Logger.Check that the resulting level is actually enabled, so it's fine
+// for implementations to do expensive work here (header sanitization, URL
+// parsing, etc). Either may return an empty msg to suppress that line
+// entirely - the built-in Common/Combined/JSON formatters only log on
+// FormatResponse.
+//
+// Register a custom Formatter via Options.Formatter to take full control of
+// field names and redaction instead of picking one of the Format presets.
+type Formatter interface {
+	ContextFields(r *http.Request, reqID string) []zapcore.Field
+	FormatRequest(r *http.Request, reqID string) (msg string, fields []zapcore.Field)
+	FormatResponse(r *http.Request, status, bytes int, header http.Header, elapsed time.Duration, body []byte) (msg string, fields []zapcore.Field)
+}
+
+func formatterFor(opts *Options) Formatter {
+	if opts.Formatter != nil {
+		return opts.Formatter
+	}
+	switch opts.Format {
+	case FormatCommon:
+		return commonLogFormatter{combined: false}
+	case FormatCombined:
+		return commonLogFormatter{combined: true}
+	case FormatJSON:
+		return jsonLogFormatter{
+			skipHeaders:   opts.SkipHeaders,
+			skipURLParams: opts.SkipURLParams,
+		}
+	default:
+		return defaultLogFormatter{
+			concise:       opts.Concise,
+			skipHeaders:   opts.SkipHeaders,
+			skipURLParams: opts.SkipURLParams,
+		}
+	}
+}
+
+// headerObject is a zapcore.ObjectMarshaler over a sanitized header map, so
+// encoding it costs nothing beyond the encoder calls themselves - no
+// intermediate map[string]interface{} required.
+type headerObject map[string]string
+
+func (h headerObject) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	for k, v := range h {
+		enc.AddString(k, v)
+	}
+	return nil
+}
+
+// defaultLogFormatter reproduces httpzaplog's original httpRequest/httpResponse
+// shape.
+type defaultLogFormatter struct {
+	concise       bool
+	skipHeaders   []string
+	skipURLParams []string
+}
+
+func (f defaultLogFormatter) ContextFields(r *http.Request, reqID string) []zapcore.Field {
+	fields := []zapcore.Field{
+		zap.String("requestMethod", r.Method),
+		zap.String("requestPath", r.URL.Path),
+	}
+	if reqID != "" {
+		fields = append(fields, zap.String("requestID", reqID))
+	}
+	return fields
+}
+
+// httpRequestObject is a zapcore.ObjectMarshaler for the full httpRequest log
+// entry, used instead of zap.Any so encoding happens without an intermediate
+// map[string]interface{}.
+type httpRequestObject struct {
+	url    string
+	method string
+	path   string
+	ip     string
+	proto  string
+	reqID  string
+	scheme string
+	header headerObject
+}
+
+func (o httpRequestObject) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("requestURL", o.url)
+	enc.AddString("requestMethod", o.method)
+	enc.AddString("requestPath", o.path)
+	enc.AddString("remoteIP", o.ip)
+	enc.AddString("proto", o.proto)
+	if o.reqID != "" {
+		enc.AddString("requestID", o.reqID)
+	}
+	if o.scheme != "" {
+		enc.AddString("scheme", o.scheme)
+	}
+	if o.header != nil {
+		return enc.AddObject("header", o.header)
+	}
+	return nil
+}
+
+func (f defaultLogFormatter) FormatRequest(r *http.Request, reqID string) (string, []zapcore.Field) {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	// Make sure to sanitize the get parameters in the request URL.
+	var requestURL string
+	parsed, err := url.Parse(r.RequestURI)
+	if err != nil {
+		requestURL = fmt.Sprintf("%s://%s%s", scheme, r.Host, r.URL.Path)
+	} else {
+		urlValues := parsed.Query()
+		for urlK := range urlValues {
+			if slices.Contains(f.skipURLParams, urlK) {
+				urlValues.Set(urlK, "***")
+			}
+		}
+		parsed.RawQuery = urlValues.Encode()
+		requestURL = fmt.Sprintf("%s://%s%s", scheme, r.Host, parsed.String())
+	}
+
+	obj := httpRequestObject{
+		url:    requestURL,
+		method: r.Method,
+		path:   r.URL.Path,
+		ip:     r.RemoteAddr,
+		proto:  r.Proto,
+		reqID:  reqID,
+	}
+
+	if f.concise {
+		return "", []zapcore.Field{zap.Object("httpRequest", obj)}
+	}
+
+	obj.scheme = scheme
+	if len(r.Header) > 0 {
+		obj.header = headerLogField(r.Header, f.skipHeaders, f.skipURLParams)
+	}
+
+	msg := fmt.Sprintf("Request: %s %s", r.Method, r.URL.Path)
+	return msg, []zapcore.Field{zap.Object("httpRequest", obj)}
+}
+
+// httpResponseObject is a zapcore.ObjectMarshaler for the full httpResponse
+// log entry.
+type httpResponseObject struct {
+	status  int
+	bytes   int
+	elapsed time.Duration
+	body    string
+	header  headerObject
+}
+
+func (o httpResponseObject) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddInt("status", o.status)
+	enc.AddInt("bytes", o.bytes)
+	enc.AddFloat64("elapsed", float64(o.elapsed.Nanoseconds())/1000000.0) // in milliseconds
+	if o.body != "" {
+		enc.AddString("body", o.body)
+	}
+	if o.header != nil {
+		return enc.AddObject("header", o.header)
+	}
+	return nil
+}
+
+func (f defaultLogFormatter) FormatResponse(r *http.Request, status, bytes int, header http.Header, elapsed time.Duration, body []byte) (string, []zapcore.Field) {
+	msg := fmt.Sprintf("Response: %d %s", status, statusLabel(status))
+
+	obj := httpResponseObject{
+		status:  status,
+		bytes:   bytes,
+		elapsed: elapsed,
+	}
+
+	if !f.concise {
+		// Include response header, as well for error status codes (>=400) we include
+		// the response body so we may inspect the log message sent back to the client.
+		if status >= 400 {
+			obj.body = string(body)
+		}
+		if len(header) > 0 {
+			obj.header = headerLogField(header, f.skipHeaders, f.skipURLParams)
+		}
+	}
+
+	fields := []zapcore.Field{zap.Object("httpResponse", obj)}
+	if f.concise {
+		// Concise mode logs no request line, so the response line carries
+		// the concise httpRequest object instead.
+		_, reqFields := f.FormatRequest(r, middleware.GetReqID(r.Context()))
+		fields = append(fields, reqFields...)
+	}
+	return msg, fields
+}
+
+// commonLogFormatter emits NCSA Common Log Format (and, with combined set,
+// Combined Log Format) lines. It logs nothing on FormatRequest - access logs
+// are written once the response is known.
+type commonLogFormatter struct {
+	combined bool
+}
+
+func (f commonLogFormatter) ContextFields(r *http.Request, reqID string) []zapcore.Field {
+	if reqID == "" {
+		return nil
+	}
+	return []zapcore.Field{zap.String("requestID", reqID)}
+}
+
+func (f commonLogFormatter) FormatRequest(r *http.Request, reqID string) (string, []zapcore.Field) {
+	return "", nil
+}
+
+func (f commonLogFormatter) FormatResponse(r *http.Request, status, bytes int, header http.Header, elapsed time.Duration, body []byte) (string, []zapcore.Field) {
+	host := r.RemoteAddr
+	if idx := strings.LastIndex(host, ":"); idx != -1 {
+		host = host[:idx]
+	}
+
+	user := "-"
+	if r.URL.User != nil {
+		if name := r.URL.User.Username(); name != "" {
+			user = name
+		}
+	}
+
+	msg := fmt.Sprintf(`%s - %s [%s] "%s %s %s" %d %d`,
+		host, user, time.Now().Format("02/Jan/2006:15:04:05 -0700"),
+		r.Method, r.URL.RequestURI(), r.Proto, status, bytes,
+	)
+	if f.combined {
+		msg = fmt.Sprintf("%s %q %q", msg, r.Referer(), r.UserAgent())
+	}
+
+	return msg, nil
+}
+
+// cloudEventType is the CloudEvents "type" attribute httpzaplog stamps onto
+// every FormatJSON event - see
+// https://github.com/cloudevents/spec/blob/v1.0.2/cloudevents/spec.md#type.
+const cloudEventType = "com.illumitacit.httpzaplog.http.response"
+
+// jsonResponseData is the "data" payload of a FormatJSON CloudEvents
+// envelope.
+type jsonResponseData struct {
+	method    string
+	url       string
+	status    int
+	bytes     int
+	userAgent string
+	ip        string
+	referer   string
+	elapsed   time.Duration
+	proto     string
+	header    headerObject
+}
+
+func (o jsonResponseData) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("requestMethod", o.method)
+	enc.AddString("requestUrl", o.url)
+	enc.AddInt("status", o.status)
+	enc.AddInt("responseSize", o.bytes)
+	enc.AddString("userAgent", o.userAgent)
+	enc.AddString("remoteIp", o.ip)
+	enc.AddString("referer", o.referer)
+	enc.AddString("latency", o.elapsed.String())
+	enc.AddString("protocol", o.proto)
+	if o.header != nil {
+		return enc.AddObject("responseHeader", o.header)
+	}
+	return nil
+}
+
+// cloudEventsObject is a zapcore.ObjectMarshaler for a CloudEvents v1.0
+// envelope - specversion/type/source/id/time/datacontenttype are the
+// envelope's required/commonly-set context attributes, with the response's
+// fields carried as its "data" payload.
+type cloudEventsObject struct {
+	id     string
+	source string
+	time   time.Time
+	data   jsonResponseData
+}
+
+func (o cloudEventsObject) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("specversion", "1.0")
+	enc.AddString("type", cloudEventType)
+	enc.AddString("source", o.source)
+	enc.AddString("id", o.id)
+	enc.AddString("time", o.time.Format(time.RFC3339Nano))
+	enc.AddString("datacontenttype", "application/json")
+	return enc.AddObject("data", o.data)
+}
+
+// jsonLogFormatter emits a single CloudEvents envelope per request, for
+// pipelines that consume CloudEvents-shaped structured events instead of
+// httpzaplog's own httpRequest/httpResponse fields.
+type jsonLogFormatter struct {
+	skipHeaders   []string
+	skipURLParams []string
+}
+
+func (f jsonLogFormatter) ContextFields(r *http.Request, reqID string) []zapcore.Field {
+	if reqID == "" {
+		return nil
+	}
+	return []zapcore.Field{zap.String("requestID", reqID)}
+}
+
+func (f jsonLogFormatter) FormatRequest(r *http.Request, reqID string) (string, []zapcore.Field) {
+	return "", nil
+}
+
+func (f jsonLogFormatter) FormatResponse(r *http.Request, status, bytes int, header http.Header, elapsed time.Duration, body []byte) (string, []zapcore.Field) {
+	msg := fmt.Sprintf("%s %s %d", r.Method, r.URL.RequestURI(), status)
+
+	data := jsonResponseData{
+		method:    r.Method,
+		url:       r.URL.RequestURI(),
+		status:    status,
+		bytes:     bytes,
+		userAgent: r.UserAgent(),
+		ip:        r.RemoteAddr,
+		referer:   r.Referer(),
+		elapsed:   elapsed,
+		proto:     r.Proto,
+	}
+	if len(header) > 0 {
+		data.header = headerLogField(header, f.skipHeaders, f.skipURLParams)
+	}
+
+	obj := cloudEventsObject{
+		id:     middleware.GetReqID(r.Context()),
+		source: r.URL.Path,
+		time:   time.Now(),
+		data:   data,
+	}
+
+	return msg, []zapcore.Field{zap.Object("event", obj)}
+}
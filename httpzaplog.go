@@ -3,6 +3,7 @@ package httpzaplog
 import (
 	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
@@ -14,6 +15,9 @@ import (
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	"golang.org/x/exp/slices"
+
+	"github.com/illumitacit/httpzaplog/cors"
+	"github.com/illumitacit/httpzaplog/propagation"
 )
 
 type Options struct {
@@ -22,6 +26,31 @@ type Options struct {
 	// Concise determines Whether to log the entries in concise mode.
 	Concise bool
 
+	// Format selects a built-in access-log preset (see FormatDefault,
+	// FormatCommon, FormatCombined, FormatJSON). Ignored if Formatter is set.
+	Format Format
+
+	// Formatter, if set, overrides Format and takes full control of which
+	// zap fields (and how many log lines) are emitted per request.
+	Formatter Formatter
+
+	// CORS, if set, chains CORS preflight handling and origin-aware logging
+	// into the middleware built by Handler/RequestLogger.
+	CORS *CORSOptions
+
+	// Compress, if set, transparently compresses response bodies and
+	// attaches bytesIn/bytesOut/compressionRatio fields to the response log.
+	Compress *CompressOptions
+
+	// Propagation, if set, reads/generates request/trace correlation
+	// identifiers for the request and attaches them to the log entry. See
+	// package httpzaplog/propagation.
+	Propagation *propagation.Options
+
+	// Sampling, if set, rate-limits the per-request logger so high-volume
+	// endpoints don't drown out everything else - see SamplingOptions.
+	Sampling *SamplingOptions
+
 	// SkipURLParams determines which get parameters shouldn't be logged.
 	SkipURLParams []string
 
@@ -61,7 +90,13 @@ func RequestLogger(opts *Options) func(next http.Handler) http.Handler {
 }
 
 func Handler(opts *Options) func(next http.Handler) http.Handler {
-	var f middleware.LogFormatter = &requestLogger{opts}
+	rl := &requestLogger{Opts: opts, logger: opts.Logger}
+	if opts.Sampling != nil {
+		// Wrapped once, here, so the sampler cores' internal counters
+		// persist across requests instead of resetting on every call.
+		rl.logger = opts.Logger.WithOptions(zap.WrapCore(opts.Sampling.wrapCore))
+	}
+	var f middleware.LogFormatter = rl
 
 	skipPaths := map[string]struct{}{}
 	for _, path := range opts.SkipPaths {
@@ -79,23 +114,74 @@ func Handler(opts *Options) func(next http.Handler) http.Handler {
 				}
 			}
 
+			if opts.Propagation != nil {
+				r = opts.Propagation.Handle(r, middleware.GetReqID(r.Context()))
+			}
+
+			// Evaluate CORS ahead of the log entry, not after, so
+			// NewLogEntry can attach origin/corsAllowed before the
+			// "Request:" line is built - otherwise only the response line
+			// would carry them.
+			var corsResult cors.Result
+			if opts.CORS != nil {
+				corsResult = opts.CORS.Handle(w, r)
+				r = r.WithContext(withCORSResult(r.Context(), corsResult))
+				if opts.CORS.SkipPreflight && corsResult.Preflight {
+					r = r.WithContext(withCORSSkipVerbose(r.Context()))
+				}
+			}
+
 			// Log the request
 			entry := f.NewLogEntry(r)
+			rle := entry.(*RequestLoggerEntry)
+
+			if opts.CORS != nil {
+				if applyCORS(opts.CORS, corsResult, rle, w) {
+					return
+				}
+			}
+
 			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
 
-			buf := newLimitBuffer(512)
-			ww.Tee(buf)
+			var rw http.ResponseWriter = ww
+			var cw *compressWriter
+			if opts.Compress != nil {
+				if enc := negotiateEncoding(r.Header.Get("Accept-Encoding")); enc != "" {
+					cw = newCompressWriter(ww, enc, opts.Compress)
+					rw = cw
+				}
+			}
+
+			// Always tee the body: the response's eventual level - and
+			// therefore whether it's even logged - isn't known until Write,
+			// and with Options.Sampling.LevelOverrides a request whose
+			// "Request:" line got sampled out can still escalate to a status
+			// that's always logged (e.g. 5xx); skipping the tee here would
+			// silently lose that response's body. When compression is
+			// active, tee cw (pre-compression) rather than ww, which only
+			// ever sees the compressed bytes.
+			lb := newLimitBuffer(512)
+			if cw != nil {
+				cw.Tee(lb)
+			} else {
+				ww.Tee(lb)
+			}
+			var buf io.ReadWriter = lb
 
 			t1 := time.Now()
 			defer func() {
+				if cw != nil {
+					_ = cw.Close()
+					applyCompressionFields(rle, cw, ww)
+				}
 				var respBody []byte
-				if ww.Status() >= 400 {
+				if buf != nil && ww.Status() >= 400 {
 					respBody, _ = ioutil.ReadAll(buf)
 				}
 				entry.Write(ww.Status(), ww.BytesWritten(), ww.Header(), time.Since(t1), respBody)
 			}()
 
-			next.ServeHTTP(ww, middleware.WithLogEntry(r, entry))
+			next.ServeHTTP(rw, middleware.WithLogEntry(r, entry))
 		}
 		return http.HandlerFunc(fn)
 	}
@@ -103,57 +189,114 @@ func Handler(opts *Options) func(next http.Handler) http.Handler {
 
 type requestLogger struct {
 	Opts *Options
+
+	// logger is opts.Logger, wrapped once (in Handler) with a sampling core
+	// if opts.Sampling is set, so it's shared - and its sample counters
+	// persist - across every request instead of being rebuilt per-request.
+	logger *zap.Logger
 }
 
 func (l *requestLogger) NewLogEntry(r *http.Request) middleware.LogEntry {
+	formatter := formatterFor(l.Opts)
+	reqID := middleware.GetReqID(r.Context())
+
+	// propagation.Correlation.Fields() already emits a top-level "requestID"
+	// (kept in sync with chi's own ID by Options.Propagation.Handle unless
+	// an inbound X-Request-ID overrides it) - suppress the formatter's own
+	// copy so lines don't carry two, potentially conflicting, requestID
+	// fields. FormatRequest below still gets the real reqID for its nested
+	// httpRequest.requestID field.
+	ctxFieldsReqID := reqID
+	if l.Opts.Propagation != nil {
+		ctxFieldsReqID = ""
+	}
+
+	fields := formatter.ContextFields(r, ctxFieldsReqID)
+	if l.Opts.Propagation != nil {
+		fields = append(fields, propagation.FromContext(r.Context()).Fields()...)
+	}
+
 	entry := &RequestLoggerEntry{
-		concise:       l.Opts.Concise,
-		skipURLParams: l.Opts.SkipURLParams,
-		skipHeaders:   l.Opts.SkipHeaders,
+		Logger:      l.logger.With(fields...),
+		request:     r,
+		formatter:   formatter,
+		skipVerbose: corsSkipVerbose(r.Context()),
+		samplingKey: l.Opts.Sampling.sampleKey(r),
+		sampled:     l.Opts.Sampling != nil,
 	}
-	msg := fmt.Sprintf("Request: %s %s", r.Method, r.URL.Path)
 
-	entry.Logger = l.Opts.Logger.With(l.requestLogFields(r))
-	if !l.Opts.Concise {
-		entry.Logger.Info(msg)
+	if result, ok := corsResultFromContext(r.Context()); ok {
+		entry.Logger = entry.Logger.With(
+			zap.String("origin", result.Origin),
+			zap.Bool("corsAllowed", result.Allowed),
+		)
+	}
+
+	// Only build the (potentially expensive: header sanitization, URL
+	// parsing) request log fields if Info is actually enabled.
+	if !entry.skipVerbose {
+		reqCheckMsg := entry.samplingKey
+		if entry.sampled {
+			// Distinct from the response line's check message (see
+			// responseSampleSuffix) so the two don't share a sampler bucket.
+			reqCheckMsg += requestSampleSuffix
+		}
+		ce := entry.Logger.Check(zapcore.InfoLevel, reqCheckMsg)
+		if ce != nil {
+			if msg, fields := formatter.FormatRequest(r, reqID); msg != "" {
+				ce.Message = msg
+				ce.Write(fields...)
+			}
+		}
 	}
 	return entry
 }
 
 type RequestLoggerEntry struct {
-	Logger        *zap.Logger
-	msg           string
-	concise       bool
-	skipURLParams []string
-	skipHeaders   []string
+	Logger *zap.Logger
+	msg    string
+
+	request     *http.Request
+	formatter   Formatter
+	skipVerbose bool
+
+	// samplingKey, when Options.Sampling is set, is the sampler's dedup key
+	// for this request (see SamplingOptions.KeyFunc).
+	samplingKey string
+
+	// sampled reports whether Options.Sampling was set for this request, so
+	// Write knows to distinguish its Check() message from the request
+	// line's (see requestSampleSuffix/responseSampleSuffix).
+	sampled bool
 }
 
 func (l *RequestLoggerEntry) Write(status, bytes int, header http.Header, elapsed time.Duration, extra interface{}) {
-	msg := fmt.Sprintf("Response: %d %s", status, statusLabel(status))
-	if l.msg != "" {
-		msg = fmt.Sprintf("%s - %s", msg, l.msg)
+	if l.skipVerbose {
+		return
 	}
 
-	responseLog := map[string]interface{}{
-		"status":  status,
-		"bytes":   bytes,
-		"elapsed": float64(elapsed.Nanoseconds()) / 1000000.0, // in milliseconds
+	// Only build the response log fields (response object, header map, body
+	// string) if the level this status maps to is actually enabled.
+	respCheckMsg := l.samplingKey
+	if l.sampled {
+		respCheckMsg += responseSampleSuffix
+	}
+	ce := l.Logger.Check(statusLevel(status), respCheckMsg)
+	if ce == nil {
+		return
 	}
 
-	if !l.concise {
-		// Include response header, as well for error status codes (>400) we include
-		// the response body so we may inspect the log message sent back to the client.
-		if status >= 400 {
-			body, _ := extra.([]byte)
-			responseLog["body"] = string(body)
-		}
-		if len(header) > 0 {
-			responseLog["header"] = headerLogField(header, l.skipHeaders, l.skipURLParams)
-		}
+	body, _ := extra.([]byte)
+	msg, fields := l.formatter.FormatResponse(l.request, status, bytes, header, elapsed, body)
+	if msg == "" {
+		return
+	}
+	if l.msg != "" {
+		msg = fmt.Sprintf("%s - %s", msg, l.msg)
 	}
 
-	l.Logger.With(zap.Any("httpResponse", responseLog)).
-		Log(statusLevel(status), msg)
+	ce.Message = msg
+	ce.Write(fields...)
 }
 
 func (l *RequestLoggerEntry) Panic(v interface{}, stack []byte) {
@@ -167,52 +310,6 @@ func (l *RequestLoggerEntry) Panic(v interface{}, stack []byte) {
 	middleware.PrintPrettyStack(v)
 }
 
-func (l *requestLogger) requestLogFields(r *http.Request) zapcore.Field {
-	scheme := "http"
-	if r.TLS != nil {
-		scheme = "https"
-	}
-
-	// Make sure to sanitize the get parameters in the request URL.
-	var requestURL string
-	parsed, err := url.Parse(r.RequestURI)
-	if err != nil {
-		requestURL = fmt.Sprintf("%s://%s%s", scheme, r.Host, r.URL.Path)
-	} else {
-		urlValues := parsed.Query()
-		for urlK := range urlValues {
-			if slices.Contains(l.Opts.SkipURLParams, urlK) {
-				urlValues.Set(urlK, "***")
-			}
-		}
-		parsed.RawQuery = urlValues.Encode()
-		requestURL = fmt.Sprintf("%s://%s%s", scheme, r.Host, parsed.String())
-	}
-
-	requestFields := map[string]interface{}{
-		"requestURL":    requestURL,
-		"requestMethod": r.Method,
-		"requestPath":   r.URL.Path,
-		"remoteIP":      r.RemoteAddr,
-		"proto":         r.Proto,
-	}
-	if reqID := middleware.GetReqID(r.Context()); reqID != "" {
-		requestFields["requestID"] = reqID
-	}
-
-	if l.Opts.Concise {
-		return zap.Any("httpRequest", requestFields)
-	}
-
-	requestFields["scheme"] = scheme
-
-	if len(r.Header) > 0 {
-		requestFields["header"] = headerLogField(r.Header, l.Opts.SkipHeaders, l.Opts.SkipURLParams)
-	}
-
-	return zap.Any("httpRequest", requestFields)
-}
-
 func headerLogField(header http.Header, skipHeaders []string, skipURLParams []string) map[string]string {
 	headerField := map[string]string{}
 	for k, v := range header {
@@ -298,6 +395,16 @@ func LogEntry(ctx context.Context) *zap.Logger {
 	}
 }
 
+// LogEntryFromGRPC returns the logger propagation.UnaryServerInterceptor
+// attached to ctx, or a no-op logger if none is present - the gRPC
+// equivalent of LogEntry for services that handle both protocols.
+func LogEntryFromGRPC(ctx context.Context) *zap.Logger {
+	if l := propagation.LoggerFromContext(ctx); l != nil {
+		return l
+	}
+	return zap.NewNop()
+}
+
 func LogEntrySetField(ctx context.Context, key, value string) {
 	if entry, ok := ctx.Value(middleware.LogEntryCtxKey).(*RequestLoggerEntry); ok {
 		entry.Logger = entry.Logger.With(zap.String(key, value))
@@ -0,0 +1,67 @@
+package propagation
+
+import (
+	"context"
+	"strings"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// UnaryServerInterceptor returns a grpc.UnaryServerInterceptor that reads (or
+// generates) the same correlation identifiers Handle does for HTTP, this
+// time from incoming gRPC metadata, and attaches both the Correlation and a
+// logger scoped with its fields to the context - retrievable via FromContext
+// and httpzaplog.LogEntryFromGRPC respectively.
+func UnaryServerInterceptor(logger *zap.Logger, opts Options) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		c := newCorrelation(firstOrEmpty(md, "x-request-id"), firstOrEmpty(md, "traceparent"), opts)
+		c.UserID = mdHeaderOrEmpty(md, opts.UserIDHeader)
+		c.RequestUnit = mdHeaderOrEmpty(md, opts.RequestUnitHeader)
+
+		ctx = context.WithValue(ctx, correlationKey{}, c)
+		ctx = context.WithValue(ctx, loggerKey{}, logger.With(c.Fields()...))
+		return handler(ctx, req)
+	}
+}
+
+func firstOrEmpty(md metadata.MD, key string) string {
+	values := md.Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func mdHeaderOrEmpty(md metadata.MD, key string) string {
+	if key == "" {
+		return ""
+	}
+	return firstOrEmpty(md, strings.ToLower(key))
+}
+
+// InjectGRPC returns a context carrying ctx's Correlation identifiers as
+// outgoing gRPC metadata, so an outbound gRPC call carries the same
+// request/trace IDs.
+func InjectGRPC(ctx context.Context) context.Context {
+	c := FromContext(ctx)
+	md := metadata.MD{}
+	if c.RequestID != "" {
+		md.Set("x-request-id", c.RequestID)
+	}
+	if c.TraceID != "" && c.SpanID != "" {
+		md.Set("traceparent", formatTraceparent(c.TraceID, c.SpanID))
+	}
+	if c.userIDHeader != "" && c.UserID != "" {
+		md.Set(strings.ToLower(c.userIDHeader), c.UserID)
+	}
+	if c.requestUnitHeader != "" && c.RequestUnit != "" {
+		md.Set(strings.ToLower(c.requestUnitHeader), c.RequestUnit)
+	}
+	if existing, ok := metadata.FromOutgoingContext(ctx); ok {
+		md = metadata.Join(existing, md)
+	}
+	return metadata.NewOutgoingContext(ctx, md)
+}
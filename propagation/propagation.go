@@ -0,0 +1,194 @@
+// Package propagation threads request/trace correlation identifiers through
+// a service's HTTP and gRPC paths, so httpzaplog.LogEntry and
+// httpzaplog.LogEntryFromGRPC return a logger carrying the same fields
+// regardless of which protocol handled the call, and so outbound calls
+// (InjectHTTP, InjectGRPC) carry those identifiers onward.
+package propagation
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Options configures which additional correlation headers are read/generated
+// by Handle, Middleware, and UnaryServerInterceptor, beyond X-Request-ID and
+// traceparent, which are always handled.
+type Options struct {
+	// UserIDHeader, if set, is read into Correlation.UserID and echoed back
+	// by InjectHTTP/InjectGRPC.
+	UserIDHeader string
+
+	// RequestUnitHeader, if set, behaves like UserIDHeader for a
+	// caller-defined "request unit" (e.g. tenant, billing account).
+	RequestUnitHeader string
+}
+
+// Correlation holds the identifiers read or generated for a single request,
+// stored on its context and echoed onto outbound calls by InjectHTTP/
+// InjectGRPC.
+type Correlation struct {
+	RequestID string
+	TraceID   string
+	SpanID    string
+
+	// ParentSpanID is the parent-id segment of the inbound traceparent
+	// header, i.e. the caller's own span id - empty if there was no valid
+	// inbound traceparent, meaning this hop starts a new trace.
+	ParentSpanID string
+
+	UserID      string
+	RequestUnit string
+
+	userIDHeader      string
+	requestUnitHeader string
+}
+
+// Fields returns the zap fields this correlation should be logged with.
+func (c Correlation) Fields() []zapcore.Field {
+	fields := make([]zapcore.Field, 0, 6)
+	if c.RequestID != "" {
+		fields = append(fields, zap.String("requestID", c.RequestID))
+	}
+	if c.TraceID != "" {
+		fields = append(fields, zap.String("traceID", c.TraceID))
+	}
+	if c.SpanID != "" {
+		fields = append(fields, zap.String("spanID", c.SpanID))
+	}
+	if c.ParentSpanID != "" {
+		fields = append(fields, zap.String("parentSpanID", c.ParentSpanID))
+	}
+	if c.UserID != "" {
+		fields = append(fields, zap.String("userID", c.UserID))
+	}
+	if c.RequestUnit != "" {
+		fields = append(fields, zap.String("requestUnit", c.RequestUnit))
+	}
+	return fields
+}
+
+type correlationKey struct{}
+
+// FromContext returns the Correlation that Handle/Middleware or
+// UnaryServerInterceptor stored on ctx, or the zero value if none is
+// present.
+func FromContext(ctx context.Context) Correlation {
+	c, _ := ctx.Value(correlationKey{}).(Correlation)
+	return c
+}
+
+type loggerKey struct{}
+
+// LoggerFromContext returns the *zap.Logger UnaryServerInterceptor attached
+// to ctx, or nil if none is present. httpzaplog.LogEntryFromGRPC wraps this
+// for gRPC services.
+func LoggerFromContext(ctx context.Context) *zap.Logger {
+	l, _ := ctx.Value(loggerKey{}).(*zap.Logger)
+	return l
+}
+
+// Handle reads (or generates) an X-Request-ID and W3C traceparent header,
+// plus the optional UserIDHeader/RequestUnitHeader, and returns r with the
+// resulting Correlation attached to its context. fallbackRequestID is used
+// as the RequestID when the request carries no X-Request-ID header - pass
+// the request ID an upstream middleware already assigned (e.g. chi's
+// middleware.GetReqID) so it isn't shadowed by a second, independently
+// generated one that ends up logged as a conflicting "requestID" field.
+func (opts Options) Handle(r *http.Request, fallbackRequestID string) *http.Request {
+	requestID := r.Header.Get("X-Request-ID")
+	if requestID == "" {
+		requestID = fallbackRequestID
+	}
+	c := newCorrelation(requestID, r.Header.Get("traceparent"), opts)
+	c.UserID = headerOrEmpty(r.Header, opts.UserIDHeader)
+	c.RequestUnit = headerOrEmpty(r.Header, opts.RequestUnitHeader)
+	return r.WithContext(context.WithValue(r.Context(), correlationKey{}, c))
+}
+
+// Middleware is the standalone http middleware form of Handle, for services
+// that want request/trace correlation (FromContext, InjectHTTP) without the
+// rest of httpzaplog. httpzaplog.Handler adds correlation fields to its log
+// entries only when its Options.Propagation is set, and it then runs Handle
+// itself, replacing any Correlation that Middleware attached.
+func Middleware(opts Options) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, opts.Handle(r, ""))
+		})
+	}
+}
+
+func headerOrEmpty(h http.Header, key string) string {
+	if key == "" {
+		return ""
+	}
+	return h.Get(key)
+}
+
+func newCorrelation(requestID, traceparent string, opts Options) Correlation {
+	c := Correlation{
+		RequestID:         requestID,
+		userIDHeader:      opts.UserIDHeader,
+		requestUnitHeader: opts.RequestUnitHeader,
+	}
+	if c.RequestID == "" {
+		c.RequestID = newHexID(16)
+	}
+
+	c.TraceID, c.ParentSpanID = parseTraceparent(traceparent)
+	if c.TraceID == "" {
+		c.TraceID = newHexID(16)
+	}
+	c.SpanID = newHexID(8)
+
+	return c
+}
+
+// parseTraceparent extracts the trace and parent span IDs from a W3C
+// traceparent header ("version-traceid-parentid-flags"). It returns ("", "")
+// for anything it doesn't recognize, so callers fall back to starting a new
+// trace. The parent span id becomes Correlation.ParentSpanID, preserving the
+// caller's place in the trace's span hierarchy - not just which trace it
+// belongs to.
+func parseTraceparent(h string) (traceID, parentSpanID string) {
+	parts := strings.Split(h, "-")
+	if len(parts) != 4 || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return "", ""
+	}
+	return parts[1], parts[2]
+}
+
+func formatTraceparent(traceID, spanID string) string {
+	return fmt.Sprintf("00-%s-%s-01", traceID, spanID)
+}
+
+func newHexID(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// InjectHTTP copies the Correlation identifiers carried by ctx onto r's
+// headers, so an outbound HTTP call carries the same request/trace IDs.
+func InjectHTTP(ctx context.Context, r *http.Request) {
+	c := FromContext(ctx)
+	if c.RequestID != "" {
+		r.Header.Set("X-Request-ID", c.RequestID)
+	}
+	if c.TraceID != "" && c.SpanID != "" {
+		r.Header.Set("traceparent", formatTraceparent(c.TraceID, c.SpanID))
+	}
+	if c.userIDHeader != "" && c.UserID != "" {
+		r.Header.Set(c.userIDHeader, c.UserID)
+	}
+	if c.requestUnitHeader != "" && c.RequestUnit != "" {
+		r.Header.Set(c.requestUnitHeader, c.RequestUnit)
+	}
+}
@@ -0,0 +1,111 @@
+package propagation
+
+import "testing"
+
+func TestParseTraceparent(t *testing.T) {
+	const (
+		validTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+		validSpanID  = "00f067aa0ba902b7"
+	)
+
+	tests := []struct {
+		name           string
+		header         string
+		wantTraceID    string
+		wantParentSpan string
+	}{
+		{
+			name:           "valid traceparent",
+			header:         "00-" + validTraceID + "-" + validSpanID + "-01",
+			wantTraceID:    validTraceID,
+			wantParentSpan: validSpanID,
+		},
+		{
+			name:   "empty header",
+			header: "",
+		},
+		{
+			name:   "too few segments",
+			header: "00-" + validTraceID + "-" + validSpanID,
+		},
+		{
+			name:   "wrong traceID length",
+			header: "00-abcd-" + validSpanID + "-01",
+		},
+		{
+			name:   "wrong spanID length",
+			header: "00-" + validTraceID + "-abcd-01",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			traceID, parentSpanID := parseTraceparent(tt.header)
+			if traceID != tt.wantTraceID {
+				t.Errorf("traceID = %q, want %q", traceID, tt.wantTraceID)
+			}
+			if parentSpanID != tt.wantParentSpan {
+				t.Errorf("parentSpanID = %q, want %q", parentSpanID, tt.wantParentSpan)
+			}
+		})
+	}
+}
+
+func TestNewCorrelationPropagatesParentSpanID(t *testing.T) {
+	const (
+		traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+		spanID  = "00f067aa0ba902b7"
+	)
+
+	c := newCorrelation("req-1", "00-"+traceID+"-"+spanID+"-01", Options{})
+
+	if c.TraceID != traceID {
+		t.Errorf("TraceID = %q, want %q", c.TraceID, traceID)
+	}
+	if c.ParentSpanID != spanID {
+		t.Errorf("ParentSpanID = %q, want %q", c.ParentSpanID, spanID)
+	}
+	if c.SpanID == "" {
+		t.Error("SpanID should always be generated for this hop")
+	}
+	if c.SpanID == c.ParentSpanID {
+		t.Error("this hop's SpanID should be freshly generated, not reused from the parent")
+	}
+}
+
+func TestNewCorrelationGeneratesIDsWhenMissing(t *testing.T) {
+	c := newCorrelation("", "", Options{})
+
+	if c.RequestID == "" {
+		t.Error("RequestID should be generated when not supplied")
+	}
+	if c.TraceID == "" {
+		t.Error("TraceID should be generated when no valid traceparent is present")
+	}
+	if c.ParentSpanID != "" {
+		t.Errorf("ParentSpanID = %q, want empty when there was no inbound traceparent", c.ParentSpanID)
+	}
+}
+
+func TestCorrelationFieldsOmitsEmptyParentSpanID(t *testing.T) {
+	c := Correlation{RequestID: "req-1", TraceID: "trace-1", SpanID: "span-1"}
+	for _, f := range c.Fields() {
+		if f.Key == "parentSpanID" {
+			t.Fatal("Fields() should omit parentSpanID when it's empty")
+		}
+	}
+
+	c.ParentSpanID = "parent-1"
+	var found bool
+	for _, f := range c.Fields() {
+		if f.Key == "parentSpanID" {
+			found = true
+			if f.String != "parent-1" {
+				t.Errorf("parentSpanID field = %q, want %q", f.String, "parent-1")
+			}
+		}
+	}
+	if !found {
+		t.Error("Fields() should include parentSpanID when set")
+	}
+}
@@ -0,0 +1,130 @@
+package httpzaplog
+
+import (
+	"net/http"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// ClassSampling overrides SamplingOptions' top-level Initial/Thereafter/Tick
+// for one zap level.
+type ClassSampling struct {
+	Initial    int
+	Thereafter int
+	Tick       time.Duration
+}
+
+// SamplingOptions configures sampled logging for high-volume endpoints via
+// Options.Sampling. Within each Tick window, the first Initial entries for a
+// given level (and sampling key, see KeyFunc) are logged verbatim; after
+// that, only every Thereafter-th one is.
+type SamplingOptions struct {
+	Initial    int
+	Thereafter int
+
+	// Tick is the sampling window's length. Defaults to one second if left
+	// at its zero value - a zero Tick would start a new window on every
+	// entry, so Initial would never be exceeded and Thereafter would never
+	// apply.
+	Tick time.Duration
+
+	// LevelOverrides overrides Initial/Thereafter/Tick for specific levels -
+	// statusLevel maps a response's status to Info (<400), Warn (4xx), or
+	// Error (5xx+). A level present with a zero ClassSampling is logged
+	// unsampled, so e.g. LevelOverrides: map[zapcore.Level]ClassSampling{
+	// zapcore.ErrorLevel: {}} always logs 5xx responses while the top-level
+	// settings sample everything else.
+	LevelOverrides map[zapcore.Level]ClassSampling
+
+	// KeyFunc, if set, gives each distinct key (e.g. route pattern) its own
+	// sampling budget. Defaults to a single budget shared by every request.
+	KeyFunc func(r *http.Request) string
+}
+
+func (s *SamplingOptions) sampleKey(r *http.Request) string {
+	if s == nil || s.KeyFunc == nil {
+		return ""
+	}
+	return s.KeyFunc(r)
+}
+
+// requestSampleSuffix/responseSampleSuffix are appended to a request's
+// sampleKey for the "Request:"/"Response:" Check() calls respectively, so
+// the two lines land in distinct sampler dedup buckets - without this, a 2xx
+// response (Info level, same as the request line) would share a counter
+// with the request line, consuming two ticks of budget per request instead
+// of one and letting the two lines independently cross the threshold.
+const (
+	requestSampleSuffix  = "\x00request"
+	responseSampleSuffix = "\x00response"
+)
+
+// wrapCore builds the zapcore.Core used by the per-request logger: entries
+// are routed to a sampler scoped to their level (built once here, so its
+// internal counters persist across requests), falling back to the top-level
+// Initial/Thereafter/Tick for any level without an override.
+func (s *SamplingOptions) wrapCore(core zapcore.Core) zapcore.Core {
+	overrides := make(map[zapcore.Level]zapcore.Core, len(s.LevelOverrides))
+	for lvl, cs := range s.LevelOverrides {
+		overrides[lvl] = sampleCore(core, cs)
+	}
+	return &levelSampledCore{
+		base:      sampleCore(core, ClassSampling{Initial: s.Initial, Thereafter: s.Thereafter, Tick: s.Tick}),
+		overrides: overrides,
+	}
+}
+
+func sampleCore(core zapcore.Core, cs ClassSampling) zapcore.Core {
+	if cs.Initial == 0 && cs.Thereafter == 0 {
+		return core // unsampled: log everything at this level
+	}
+	tick := cs.Tick
+	if tick <= 0 {
+		// A zero Tick resets the sampler's counting window on every entry,
+		// so Initial is never exceeded and Thereafter never kicks in -
+		// default it rather than silently turning sampling into a no-op.
+		tick = time.Second
+	}
+	return zapcore.NewSamplerWithOptions(core, tick, cs.Initial, cs.Thereafter)
+}
+
+// levelSampledCore dispatches Check to a per-level sampler core, so
+// different levels (and therefore different HTTP status classes) can have
+// independent sampling rates - e.g. always logging 5xx while sampling 2xx at
+// 1/100.
+type levelSampledCore struct {
+	base      zapcore.Core
+	overrides map[zapcore.Level]zapcore.Core
+}
+
+func (c *levelSampledCore) Enabled(lvl zapcore.Level) bool { return c.base.Enabled(lvl) }
+
+func (c *levelSampledCore) With(fields []zapcore.Field) zapcore.Core {
+	overrides := make(map[zapcore.Level]zapcore.Core, len(c.overrides))
+	for lvl, core := range c.overrides {
+		overrides[lvl] = core.With(fields)
+	}
+	return &levelSampledCore{base: c.base.With(fields), overrides: overrides}
+}
+
+func (c *levelSampledCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if core, ok := c.overrides[ent.Level]; ok {
+		return core.Check(ent, ce)
+	}
+	return c.base.Check(ent, ce)
+}
+
+func (c *levelSampledCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	return c.base.Write(ent, fields)
+}
+
+func (c *levelSampledCore) Sync() error {
+	err := c.base.Sync()
+	for _, core := range c.overrides {
+		if syncErr := core.Sync(); syncErr != nil && err == nil {
+			err = syncErr
+		}
+	}
+	return err
+}
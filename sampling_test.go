@@ -0,0 +1,147 @@
+package httpzaplog
+
+import (
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// enabledCore returns a core that is enabled at every level and discards its
+// output, so Check returns nil only when an entry is sampled out.
+func enabledCore() zapcore.Core {
+	return zapcore.NewCore(zapcore.NewJSONEncoder(zapcore.EncoderConfig{}), zapcore.AddSync(io.Discard), zapcore.DebugLevel)
+}
+
+// syncCountingCore wraps a zapcore.Core purely to count Sync calls, so tests
+// can assert levelSampledCore.Sync fans out to every sub-core it holds.
+type syncCountingCore struct {
+	zapcore.Core
+	mu    sync.Mutex
+	syncs int
+}
+
+func (c *syncCountingCore) Sync() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.syncs++
+	return c.Core.Sync()
+}
+
+func (c *syncCountingCore) syncCount() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.syncs
+}
+
+func TestSampleCoreUnsampledWhenZero(t *testing.T) {
+	base := zapcore.NewNopCore()
+	got := sampleCore(base, ClassSampling{})
+	if got != base {
+		t.Fatalf("sampleCore with zero Initial/Thereafter should return the core unmodified")
+	}
+}
+
+func TestSampleCoreDefaultsZeroTick(t *testing.T) {
+	// A zero Tick must not panic or hang zapcore.NewSamplerWithOptions - it
+	// should be defaulted to one second (see sampleCore's comment).
+	core := sampleCore(enabledCore(), ClassSampling{Initial: 1, Thereafter: 10})
+	if core == nil {
+		t.Fatal("sampleCore returned nil")
+	}
+
+	// With the one-second default, a second entry at the same instant falls in
+	// the same window past Initial and is sampled out; a zero Tick would start
+	// a new window for it and log it.
+	ent := zapcore.Entry{Level: zapcore.InfoLevel, Time: time.Now()}
+	if core.Check(ent, nil) == nil {
+		t.Fatal("first entry unexpectedly sampled out")
+	}
+	if core.Check(ent, nil) != nil {
+		t.Fatal("second entry in the same window should be sampled out past Initial")
+	}
+}
+
+func TestLevelSampledCoreDispatchesOverridesByLevel(t *testing.T) {
+	base := &syncCountingCore{Core: enabledCore()}
+	s := &SamplingOptions{
+		Initial:    0,
+		Thereafter: 1000, // top-level: log only every 1000th entry
+		LevelOverrides: map[zapcore.Level]ClassSampling{
+			zapcore.ErrorLevel: {}, // always log errors, unsampled
+		},
+	}
+	core := s.wrapCore(base)
+
+	lsc, ok := core.(*levelSampledCore)
+	if !ok {
+		t.Fatalf("wrapCore returned %T, want *levelSampledCore", core)
+	}
+	if _, ok := lsc.overrides[zapcore.ErrorLevel]; !ok {
+		t.Fatal("ErrorLevel override missing from levelSampledCore.overrides")
+	}
+
+	// Error-level entries should always pass Check, regardless of how many
+	// were already seen, since the override is unsampled.
+	for i := 0; i < 5; i++ {
+		ent := zapcore.Entry{Level: zapcore.ErrorLevel}
+		ce := core.Check(ent, nil)
+		if ce == nil {
+			t.Fatalf("iteration %d: ErrorLevel Check returned nil, want always-logged", i)
+		}
+	}
+}
+
+func TestLevelSampledCoreSyncFansOutToOverrides(t *testing.T) {
+	base := &syncCountingCore{Core: zapcore.NewNopCore()}
+	override := &syncCountingCore{Core: zapcore.NewNopCore()}
+	lsc := &levelSampledCore{
+		base:      base,
+		overrides: map[zapcore.Level]zapcore.Core{zapcore.ErrorLevel: override},
+	}
+
+	if err := lsc.Sync(); err != nil {
+		t.Fatalf("Sync() = %v, want nil", err)
+	}
+	if base.syncCount() != 1 {
+		t.Errorf("base.syncs = %d, want 1", base.syncCount())
+	}
+	if override.syncCount() != 1 {
+		t.Errorf("override.syncs = %d, want 1", override.syncCount())
+	}
+}
+
+func TestRequestAndResponseSampleKeysDontCollide(t *testing.T) {
+	// The request line and an Info-level (2xx/3xx) response line must land
+	// in distinct sampler buckets, or they'd share one counter and a second
+	// request's response line could get sampled out by the first request's
+	// request line (and vice versa).
+	s := &SamplingOptions{Initial: 1, Thereafter: 1000000, Tick: time.Hour}
+	core := s.wrapCore(enabledCore())
+
+	// First request: its "Request:" line (requestSampleSuffix key) is the
+	// first occurrence of that key, so it must log.
+	reqCE := core.Check(zapcore.Entry{Level: zapcore.InfoLevel, Message: requestSampleSuffix}, nil)
+	if reqCE == nil {
+		t.Fatal("first request-suffixed Check unexpectedly sampled out")
+	}
+
+	// That same request's "Response:" line (responseSampleSuffix key) is a
+	// *different* key's first occurrence - with the bug (identical keys),
+	// this would be the key's second occurrence and would be sampled out by
+	// the huge Thereafter. It must still log.
+	respCE := core.Check(zapcore.Entry{Level: zapcore.InfoLevel, Message: responseSampleSuffix}, nil)
+	if respCE == nil {
+		t.Fatal("response-suffixed Check unexpectedly sampled out on its own first occurrence")
+	}
+
+	// A second request's "Request:" line reuses the requestSampleSuffix key,
+	// which already had its Initial budget spent - it should now be
+	// sampled out (Thereafter is huge).
+	secondReqCE := core.Check(zapcore.Entry{Level: zapcore.InfoLevel, Message: requestSampleSuffix}, nil)
+	if secondReqCE != nil {
+		t.Fatal("second request-suffixed Check should have been sampled out past Initial")
+	}
+}